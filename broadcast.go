@@ -0,0 +1,110 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType identifies the kind of change a Broadcaster Event describes.
+type EventType int
+
+const (
+	EventListCreated EventType = iota
+	EventMemberSubscribed
+	EventMemberUnsubscribed
+	EventMembersReloaded
+)
+
+// Event describes a single successful change made through MLMMJWrapper.
+type Event struct {
+	Type EventType
+	List string
+	Mail string
+	Mode UserType
+}
+
+// subscriberBuffer is the number of events a registered channel can hold
+// before it is considered a slow consumer and further events for it are
+// dropped rather than blocking Publish.
+const subscriberBuffer = 16
+
+// Broadcaster fans out Events to any number of registered listeners. It
+// is safe for concurrent use. A slow consumer never blocks Publish: its
+// channel is simply skipped and DroppedCount is incremented.
+type Broadcaster struct {
+	mutex       sync.Mutex
+	nextID      int
+	subscribers map[int]chan Event
+	dropped     uint64
+}
+
+// NewBroadcaster returns an empty Broadcaster.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[int]chan Event)}
+}
+
+// Register returns a channel that receives every Event published after
+// registration. The channel is closed and unregistered automatically
+// once ctx is cancelled.
+func (b *Broadcaster) Register(ctx context.Context) <-chan Event {
+	ch := make(chan Event, subscriberBuffer)
+	b.mutex.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = ch
+	b.mutex.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mutex.Lock()
+		if sub, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(sub)
+		}
+		b.mutex.Unlock()
+	}()
+	return ch
+}
+
+// Publish sends ev to every registered listener. Listeners that cannot
+// keep up do not block the others: the event is dropped for them and
+// DroppedCount is incremented.
+func (b *Broadcaster) Publish(ev Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			atomic.AddUint64(&b.dropped, 1)
+		}
+	}
+}
+
+// DroppedCount returns the number of events dropped so far because a
+// listener's channel was full.
+func (b *Broadcaster) DroppedCount() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
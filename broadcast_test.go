@@ -0,0 +1,103 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBroadcasterPublishDeliversToAllSubscribers(t *testing.T) {
+	b := NewBroadcaster()
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	ch1 := b.Register(ctx1)
+	ch2 := b.Register(ctx2)
+
+	b.Publish(Event{Type: EventListCreated, List: "test"})
+
+	for _, ch := range []<-chan Event{ch1, ch2} {
+		select {
+		case ev := <-ch:
+			if ev.List != "test" || ev.Type != EventListCreated {
+				t.Fatalf("unexpected event: %+v", ev)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestBroadcasterDropsSlowConsumer(t *testing.T) {
+	b := NewBroadcaster()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := b.Register(ctx)
+
+	// fill the subscriber's buffer, then publish one more: that one must
+	// be dropped rather than blocking Publish.
+	for i := 0; i < subscriberBuffer; i++ {
+		b.Publish(Event{Type: EventListCreated, List: "test"})
+	}
+	b.Publish(Event{Type: EventListCreated, List: "overflow"})
+
+	if got := b.DroppedCount(); got != 1 {
+		t.Fatalf("DroppedCount() = %d, want 1", got)
+	}
+
+	// the channel should still hold exactly subscriberBuffer events, none
+	// of them the dropped one.
+	for i := 0; i < subscriberBuffer; i++ {
+		select {
+		case ev := <-ch:
+			if ev.List != "test" {
+				t.Fatalf("got unexpected event %+v, should not have been dropped before the overflow one", ev)
+			}
+		default:
+			t.Fatalf("expected %d buffered events, got fewer", subscriberBuffer)
+		}
+	}
+}
+
+func TestBroadcasterUnregistersOnContextCancel(t *testing.T) {
+	b := NewBroadcaster()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := b.Register(ctx)
+	cancel()
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatal("channel was not closed after ctx cancellation")
+		}
+	}
+}
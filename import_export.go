@@ -0,0 +1,226 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"time"
+)
+
+// MemberSpec describes the desired membership of a single mail address,
+// as used by ImportMembers and returned by ExportMembers.
+type MemberSpec struct {
+	Mail string
+	Mode UserType
+	// DisplayName is reserved for a future mlmmj version or companion
+	// address book; mlmmj-sub/-unsub have no notion of a display name,
+	// so it is currently accepted but otherwise unused.
+	DisplayName string
+}
+
+// ImportOptions controls how ImportMembers reconciles the desired
+// membership against what is currently subscribed.
+type ImportOptions struct {
+	// DryRun computes the ImportReport without issuing any Sub/Unsub
+	// calls.
+	DryRun bool
+	// RemoveMissing unsubscribes mail addresses that are currently
+	// subscribed but not present in the desired members.
+	RemoveMissing bool
+	// Parallelism is the number of Sub/Unsub calls issued concurrently,
+	// defaulting to 1 (sequential) if zero or negative.
+	Parallelism int
+	// SkipConfirmation subscribes addresses directly instead of the
+	// default of sending mlmmj's confirmation mail and waiting for the
+	// subscriber to reply before they are actually added.
+	SkipConfirmation bool
+	// SkipWelcome suppresses the welcome mail mlmmj sends on subscribe.
+	SkipWelcome bool
+}
+
+// ImportItem is the outcome of reconciling a single MemberSpec.
+type ImportItem struct {
+	Mail     string
+	Mode     UserType
+	Action   string
+	Err      error
+	Duration time.Duration
+}
+
+// ImportReport is the result of a single ImportMembers call.
+type ImportReport struct {
+	Items []ImportItem
+}
+
+// ExportMembers returns the current membership of name as MemberSpecs,
+// covering subscribers, digest and nomail members.
+func (wrapper *MLMMJWrapper) ExportMembers(ctx context.Context, spool, name string) ([]MemberSpec, error) {
+	subs, digest, nomail, err := wrapper.ListAllMembers(ctx, spool, name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]MemberSpec, 0, len(subs)+len(digest)+len(nomail))
+	for _, mail := range subs {
+		res = append(res, MemberSpec{Mail: mail, Mode: Subscriber})
+	}
+	for _, mail := range digest {
+		res = append(res, MemberSpec{Mail: mail, Mode: Digest})
+	}
+	for _, mail := range nomail {
+		res = append(res, MemberSpec{Mail: mail, Mode: Nomail})
+	}
+	return res, nil
+}
+
+// ImportMembers reconciles name's membership with members: mail
+// addresses missing from the list are subscribed, addresses that are
+// subscribed under a different mode are moved, and, if
+// opts.RemoveMissing is set, addresses subscribed but absent from
+// members are unsubscribed. It issues the minimum set of Sub/Unsub
+// calls, each of which still takes the list's write lock as usual.
+func (wrapper *MLMMJWrapper) ImportMembers(ctx context.Context, spool, name string, members []MemberSpec, opts ImportOptions) (ImportReport, error) {
+	current := make(map[string]UserType)
+	subs, digest, nomail, err := wrapper.ListAllMembers(ctx, spool, name)
+	if err != nil {
+		return ImportReport{}, err
+	}
+	for _, mail := range subs {
+		current[mail] = Subscriber
+	}
+	for _, mail := range digest {
+		current[mail] = Digest
+	}
+	for _, mail := range nomail {
+		current[mail] = Nomail
+	}
+
+	// members may list the same address more than once (e.g. a stale
+	// export merged with a fresher one); keep only the last entry for
+	// each mail so a single task is scheduled per address instead of two
+	// tasks racing each other against the same stale current[] snapshot.
+	deduped := make(map[string]MemberSpec, len(members))
+	var order []string
+	for _, m := range members {
+		if _, ok := deduped[m.Mail]; !ok {
+			order = append(order, m.Mail)
+		}
+		deduped[m.Mail] = m
+	}
+
+	desired := make(map[string]UserType, len(deduped))
+	for _, mail := range order {
+		desired[mail] = deduped[mail].Mode
+	}
+
+	type task func() ImportItem
+	var tasks []task
+	for _, mail := range order {
+		m := deduped[mail]
+		cur, alreadyMember := current[m.Mail]
+		if alreadyMember && cur == m.Mode {
+			continue
+		}
+		oldMode, movingFrom := cur, alreadyMember
+		action := "sub"
+		if movingFrom {
+			action = "move"
+		}
+		tasks = append(tasks, func() ImportItem {
+			if movingFrom && !opts.DryRun {
+				if _, err := wrapper.Unsub(ctx, unsubRequest(spool, name, m.Mail, oldMode)); err != nil {
+					return ImportItem{Mail: m.Mail, Mode: m.Mode, Action: action, Err: err}
+				}
+			}
+			return wrapper.applySub(ctx, spool, name, m, action, opts)
+		})
+	}
+	if opts.RemoveMissing {
+		for mail, mode := range current {
+			if _, ok := desired[mail]; ok {
+				continue
+			}
+			mail, mode := mail, mode
+			tasks = append(tasks, func() ImportItem {
+				return wrapper.applyUnsub(ctx, spool, name, mail, mode, opts)
+			})
+		}
+	}
+
+	parallelism := opts.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	items := make([]ImportItem, len(tasks))
+	sem := make(chan struct{}, parallelism)
+	done := make(chan struct{})
+	for i, t := range tasks {
+		i, t := i, t
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; done <- struct{}{} }()
+			items[i] = t()
+		}()
+	}
+	for range tasks {
+		<-done
+	}
+	return ImportReport{Items: items}, nil
+}
+
+func unsubRequest(spool, name, mail string, mode UserType) UnsubRequest {
+	r := NewUnsubRequest(mail, name)
+	r.Spool = spool
+	r.Mode = mode
+	return r
+}
+
+func (wrapper *MLMMJWrapper) applySub(ctx context.Context, spool, name string, m MemberSpec, action string, opts ImportOptions) ImportItem {
+	start := time.Now()
+	item := ImportItem{Mail: m.Mail, Mode: m.Mode, Action: action}
+	if opts.DryRun {
+		item.Duration = time.Since(start)
+		return item
+	}
+	r := NewSubRequest(m.Mail, name)
+	r.Spool = spool
+	r.Mode = m.Mode
+	r.WelcomeMail = !opts.SkipWelcome
+	r.ConfirmationMail = !opts.SkipConfirmation
+	_, err := wrapper.Sub(ctx, r)
+	item.Err = err
+	item.Duration = time.Since(start)
+	return item
+}
+
+func (wrapper *MLMMJWrapper) applyUnsub(ctx context.Context, spool, name, mail string, mode UserType, opts ImportOptions) ImportItem {
+	start := time.Now()
+	item := ImportItem{Mail: mail, Mode: mode, Action: "unsub"}
+	if opts.DryRun {
+		item.Duration = time.Since(start)
+		return item
+	}
+	_, err := wrapper.Unsub(ctx, unsubRequest(spool, name, mail, mode))
+	item.Err = err
+	item.Duration = time.Since(start)
+	return item
+}
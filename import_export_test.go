@@ -0,0 +1,181 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// importFakeHandler is an in-memory MLMMJHandler backing ImportMembers
+// tests: Sub/Unsub mutate members and List reports the current state,
+// so a full ImportMembers call can be exercised without a real mlmmj
+// install.
+type importFakeHandler struct {
+	mu      sync.Mutex
+	members map[UserType]map[string]bool
+}
+
+func newImportFakeHandler() *importFakeHandler {
+	return &importFakeHandler{members: map[UserType]map[string]bool{
+		Subscriber: {},
+		Digest:     {},
+		Nomail:     {},
+	}}
+}
+
+func (h *importFakeHandler) MakeML(ctx context.Context, spool, name, domain, owner, lang string) (string, error) {
+	return "", nil
+}
+
+func (h *importFakeHandler) Sub(ctx context.Context, r SubRequest) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.members[r.Mode][r.Mail] = true
+	return "", nil
+}
+
+func (h *importFakeHandler) Unsub(ctx context.Context, r UnsubRequest) (string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.members[r.Mode], r.Mail)
+	return "", nil
+}
+
+func (h *importFakeHandler) List(ctx context.Context, spool, name string, mode UserType) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make([]string, 0, len(h.members[mode]))
+	for mail := range h.members[mode] {
+		res = append(res, mail)
+	}
+	return res, nil
+}
+
+func (h *importFakeHandler) Count(ctx context.Context, spool, name string, mode UserType) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.members[mode]), nil
+}
+
+func newImportTestWrapper(t *testing.T, handler MLMMJHandler) (*MLMMJWrapper, string) {
+	t.Helper()
+	spool := t.TempDir()
+	if err := os.Mkdir(filepath.Join(spool, "list"), 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+	wrapper, err := NewMLMMJWrapper([]string{spool}, handler)
+	if err != nil {
+		t.Fatalf("NewMLMMJWrapper: %v", err)
+	}
+	return wrapper, spool
+}
+
+func TestImportMembersMovesAddsAndRemoves(t *testing.T) {
+	handler := newImportFakeHandler()
+	handler.members[Subscriber]["a@example.com"] = true
+	handler.members[Subscriber]["b@example.com"] = true
+	handler.members[Digest]["c@example.com"] = true
+	wrapper, spool := newImportTestWrapper(t, handler)
+
+	members := []MemberSpec{
+		{Mail: "a@example.com", Mode: Digest},
+		{Mail: "b@example.com", Mode: Subscriber},
+		// duplicate "d@example.com": the later entry (Digest) must win and
+		// only one Sub task must run for it.
+		{Mail: "d@example.com", Mode: Subscriber},
+		{Mail: "d@example.com", Mode: Digest},
+	}
+
+	report, err := wrapper.ImportMembers(context.Background(), spool, "list", members, ImportOptions{RemoveMissing: true})
+	if err != nil {
+		t.Fatalf("ImportMembers: %v", err)
+	}
+
+	actions := make(map[string]string, len(report.Items))
+	for _, item := range report.Items {
+		if _, dup := actions[item.Mail]; dup {
+			t.Fatalf("duplicate ImportItem for %q, want exactly one", item.Mail)
+		}
+		if item.Err != nil {
+			t.Fatalf("ImportItem for %q: %v", item.Mail, item.Err)
+		}
+		actions[item.Mail] = item.Action
+	}
+
+	want := map[string]string{
+		"a@example.com": "move",
+		"d@example.com": "sub",
+		"c@example.com": "unsub",
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("actions = %+v, want exactly %+v (b@example.com already matched and needs no task)", actions, want)
+	}
+	for mail, action := range want {
+		if actions[mail] != action {
+			t.Fatalf("action for %q = %q, want %q", mail, actions[mail], action)
+		}
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if !handler.members[Digest]["a@example.com"] {
+		t.Fatal("a@example.com should have moved to Digest")
+	}
+	if handler.members[Subscriber]["a@example.com"] {
+		t.Fatal("a@example.com should no longer be Subscriber")
+	}
+	if !handler.members[Digest]["d@example.com"] || handler.members[Subscriber]["d@example.com"] {
+		t.Fatal("d@example.com should be Digest only, the last entry for a duplicate mail wins")
+	}
+	if handler.members[Digest]["c@example.com"] {
+		t.Fatal("c@example.com should have been removed by RemoveMissing")
+	}
+	if !handler.members[Subscriber]["b@example.com"] {
+		t.Fatal("b@example.com was already a matching Subscriber and should be untouched")
+	}
+}
+
+func TestImportMembersDryRunIssuesNoCalls(t *testing.T) {
+	handler := newImportFakeHandler()
+	handler.members[Subscriber]["a@example.com"] = true
+	wrapper, spool := newImportTestWrapper(t, handler)
+
+	report, err := wrapper.ImportMembers(context.Background(), spool, "list",
+		[]MemberSpec{{Mail: "new@example.com", Mode: Subscriber}}, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("ImportMembers: %v", err)
+	}
+	if len(report.Items) != 1 || report.Items[0].Action != "sub" {
+		t.Fatalf("report.Items = %+v, want a single pending sub", report.Items)
+	}
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	if handler.members[Subscriber]["new@example.com"] {
+		t.Fatal("DryRun must not actually subscribe new@example.com")
+	}
+}
@@ -0,0 +1,352 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JSON-RPC 2.0 error codes used on top of the standard ones, chosen from
+// the implementation-defined server-error range.
+const (
+	codeUnwatchedList   = -32001
+	codeInvalidUserType = -32002
+	codeCLIError        = -32003
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      uint64          `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (code %d)", e.Message, e.Code)
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      uint64          `json:"id"`
+}
+
+// classifyErr maps an error returned by a MLMMJHandler method into a
+// JSON-RPC error code.
+func classifyErr(err error) *rpcError {
+	switch {
+	case errors.Is(err, UnwatchedList):
+		return &rpcError{Code: codeUnwatchedList, Message: err.Error()}
+	case strings.Contains(err.Error(), "subscription type"):
+		return &rpcError{Code: codeInvalidUserType, Message: err.Error()}
+	default:
+		return &rpcError{Code: codeCLIError, Message: err.Error()}
+	}
+}
+
+// rpcTransport sends a single JSON-RPC 2.0 request and decodes its
+// result into v. JSONRPCHandler is transport-agnostic so it can run
+// over plain HTTP or a long-lived connection such as a websocket.
+type rpcTransport interface {
+	Call(ctx context.Context, method string, params, v interface{}) error
+}
+
+// JSONRPCHandler implements MLMMJHandler by speaking JSON-RPC 2.0 to a
+// remote worker, as an alternative to DockerHandler's ad-hoc POST
+// protocol.
+type JSONRPCHandler struct {
+	transport rpcTransport
+}
+
+// NewJSONRPCHandler returns a JSONRPCHandler that sends one HTTP POST
+// request per call to url.
+func NewJSONRPCHandler(url string) *JSONRPCHandler {
+	return &JSONRPCHandler{transport: &httpTransport{
+		URL:     url,
+		Client:  http.DefaultClient,
+		Timeout: 10 * time.Second,
+	}}
+}
+
+// NewJSONRPCHandlerConn returns a JSONRPCHandler that sends newline
+// delimited JSON-RPC 2.0 requests over conn, reusing the same
+// connection for every call. This is plain framing over a net.Conn, not
+// the WebSocket protocol (RFC 6455): to run it over a websocket, wrap
+// the connection with an adapter that speaks the WebSocket handshake
+// and frames and exposes the result as a net.Conn.
+func NewJSONRPCHandlerConn(conn net.Conn) *JSONRPCHandler {
+	return &JSONRPCHandler{transport: &connTransport{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}}
+}
+
+func (h *JSONRPCHandler) MakeML(ctx context.Context, spool, name, domain, owner, lang string) (string, error) {
+	params := struct {
+		Spool, Name, Domain, Owner, Lang string
+	}{spool, name, domain, owner, lang}
+	var res string
+	err := h.transport.Call(ctx, "mlmmj.makeML", params, &res)
+	return res, err
+}
+
+func (h *JSONRPCHandler) Sub(ctx context.Context, r SubRequest) (string, error) {
+	var res string
+	err := h.transport.Call(ctx, "mlmmj.sub", r, &res)
+	return res, err
+}
+
+func (h *JSONRPCHandler) Unsub(ctx context.Context, r UnsubRequest) (string, error) {
+	var res string
+	err := h.transport.Call(ctx, "mlmmj.unsub", r, &res)
+	return res, err
+}
+
+func (h *JSONRPCHandler) List(ctx context.Context, spool, name string, mode UserType) ([]string, error) {
+	params := struct {
+		Spool, Name string
+		Mode        UserType
+	}{spool, name, mode}
+	var res []string
+	err := h.transport.Call(ctx, "mlmmj.list", params, &res)
+	return res, err
+}
+
+func (h *JSONRPCHandler) Count(ctx context.Context, spool, name string, mode UserType) (int, error) {
+	params := struct {
+		Spool, Name string
+		Mode        UserType
+	}{spool, name, mode}
+	var res int
+	err := h.transport.Call(ctx, "mlmmj.count", params, &res)
+	return res, err
+}
+
+// httpTransport sends each JSON-RPC call as its own HTTP POST request.
+type httpTransport struct {
+	URL     string
+	Client  *http.Client
+	Timeout time.Duration
+	nextID  uint64
+}
+
+func (t *httpTransport) Call(ctx context.Context, method string, params, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	id := atomic.AddUint64(&t.nextID, 1)
+	reqBody, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method, Params: paramsJSON, ID: id})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.URL, strings.NewReader(string(reqBody)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.Client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return err
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	if v == nil || len(rpcResp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rpcResp.Result, v)
+}
+
+// connTransport sends requests over a single persistent connection,
+// serializing calls since the connection is not multiplexed.
+type connTransport struct {
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID uint64
+}
+
+func (t *connTransport) Call(ctx context.Context, method string, params, v interface{}) error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	id := atomic.AddUint64(&t.nextID, 1)
+	reqBody, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method, Params: paramsJSON, ID: id})
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		t.conn.SetDeadline(deadline)
+	} else {
+		// the connection is reused across calls, so a deadline set by an
+		// earlier call with its own ctx must not linger and cause a
+		// spurious timeout on this one.
+		t.conn.SetDeadline(time.Time{})
+	}
+	if _, err := t.conn.Write(append(reqBody, '\n')); err != nil {
+		return err
+	}
+	line, err := t.reader.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(line, &rpcResp); err != nil {
+		return err
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	if v == nil || len(rpcResp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(rpcResp.Result, v)
+}
+
+// ServeJSONRPC accepts connections on ln and serves h's MakeML, Sub,
+// Unsub, List and Count methods as JSON-RPC 2.0 over newline delimited
+// JSON, the counterpart to NewJSONRPCHandlerConn. It runs until ln is
+// closed or Accept returns an error.
+func ServeJSONRPC(h MLMMJHandler, ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go serveJSONRPCConn(h, conn)
+	}
+}
+
+func serveJSONRPCConn(h MLMMJHandler, conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return
+		}
+		resp := handleJSONRPCRequest(h, req)
+		respJSON, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(append(respJSON, '\n')); err != nil {
+			return
+		}
+	}
+}
+
+func handleJSONRPCRequest(h MLMMJHandler, req rpcRequest) rpcResponse {
+	resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	result, err := dispatchJSONRPC(h, req)
+	if err != nil {
+		resp.Error = classifyErr(err)
+		return resp
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &rpcError{Code: codeCLIError, Message: err.Error()}
+		return resp
+	}
+	resp.Result = resultJSON
+	return resp
+}
+
+func dispatchJSONRPC(h MLMMJHandler, req rpcRequest) (interface{}, error) {
+	ctx := context.Background()
+	switch req.Method {
+	case "mlmmj.makeML":
+		var params struct {
+			Spool, Name, Domain, Owner, Lang string
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.MakeML(ctx, params.Spool, params.Name, params.Domain, params.Owner, params.Lang)
+	case "mlmmj.sub":
+		var params SubRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.Sub(ctx, params)
+	case "mlmmj.unsub":
+		var params UnsubRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.Unsub(ctx, params)
+	case "mlmmj.list":
+		var params struct {
+			Spool, Name string
+			Mode        UserType
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.List(ctx, params.Spool, params.Name, params.Mode)
+	case "mlmmj.count":
+		var params struct {
+			Spool, Name string
+			Mode        UserType
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return h.Count(ctx, params.Spool, params.Name, params.Mode)
+	default:
+		return nil, fmt.Errorf("unknown method %q", req.Method)
+	}
+}
@@ -0,0 +1,149 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// LocalPaths configures where the mlmmj binaries live on the local
+// filesystem.
+type LocalPaths struct {
+	SubBin    string
+	UnsubBin  string
+	MakeMLBin string
+	ListBin   string
+}
+
+// NewLocalPaths returns the paths mlmmj binaries are usually installed
+// to on a bare-metal system.
+func NewLocalPaths() LocalPaths {
+	return LocalPaths{
+		SubBin:    "/usr/bin/mlmmj-sub",
+		UnsubBin:  "/usr/bin/mlmmj-unsub",
+		MakeMLBin: "/usr/bin/mlmmj-make-ml",
+		ListBin:   "/usr/bin/mlmmj-list",
+	}
+}
+
+// LocalHandler implements MLMMJHandler by invoking the mlmmj binaries
+// directly via os/exec, as opposed to DockerHandler which talks to an
+// HTTP-fronted container.
+type LocalHandler struct {
+	Paths LocalPaths
+	// WorkDir is the working directory the commands are run in, empty
+	// means inherit the working directory of the current process.
+	WorkDir string
+	// Env contains additional environment variables passed to the
+	// commands, on top of the current process environment.
+	Env []string
+	// SudoUser, if not empty, runs the command as "sudo -u SudoUser ...".
+	SudoUser string
+	Timeout  time.Duration
+}
+
+// NewLocalHandler returns a LocalHandler using paths, a ten second
+// timeout and no sudo user, mirroring the defaults of NewDockerHandler.
+func NewLocalHandler(paths LocalPaths) *LocalHandler {
+	return &LocalHandler{
+		Paths:   paths,
+		Timeout: 10 * time.Second,
+	}
+}
+
+func (handler *LocalHandler) run(ctx context.Context, bin string, args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, handler.Timeout)
+	defer cancel()
+	name, cmdArgs := bin, args
+	if handler.SudoUser != "" {
+		name = "sudo"
+		cmdArgs = append([]string{"-u", handler.SudoUser, bin}, args...)
+	}
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
+	cmd.Dir = handler.WorkDir
+	if len(handler.Env) > 0 {
+		cmd.Env = append(cmd.Environ(), handler.Env...)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	runErr := cmd.Run()
+	output := out.String()
+	if runErr != nil {
+		return output, fmt.Errorf("%s: %w", bin, runErr)
+	}
+	return output, nil
+}
+
+func (handler *LocalHandler) MakeML(ctx context.Context, spool, name, domain, owner, lang string) (string, error) {
+	args, argsErr := GetMakeMLArgs(spool, name, domain, owner, lang)
+	if argsErr != nil {
+		return "", argsErr
+	}
+	return handler.run(ctx, handler.Paths.MakeMLBin, args)
+}
+
+func (handler *LocalHandler) Sub(ctx context.Context, r SubRequest) (string, error) {
+	args, argsErr := r.GetArgs()
+	if argsErr != nil {
+		return "", argsErr
+	}
+	return handler.run(ctx, handler.Paths.SubBin, args)
+}
+
+func (handler *LocalHandler) Unsub(ctx context.Context, r UnsubRequest) (string, error) {
+	args, argsErr := r.GetArgs()
+	if argsErr != nil {
+		return "", argsErr
+	}
+	return handler.run(ctx, handler.Paths.UnsubBin, args)
+}
+
+func (handler *LocalHandler) List(ctx context.Context, spool, name string, mode UserType) ([]string, error) {
+	args, argsErr := GetListArgs(spool, name, mode, false)
+	if argsErr != nil {
+		return nil, argsErr
+	}
+	out, err := handler.run(ctx, handler.Paths.ListBin, args)
+	if err != nil {
+		return nil, err
+	}
+	return parseListOutput(strings.NewReader(out))
+}
+
+func (handler *LocalHandler) Count(ctx context.Context, spool, name string, mode UserType) (int, error) {
+	args, argsErr := GetListArgs(spool, name, mode, true)
+	if argsErr != nil {
+		return -1, argsErr
+	}
+	out, err := handler.run(ctx, handler.Paths.ListBin, args)
+	if err != nil {
+		return -1, err
+	}
+	return parseCountOutput(strings.NewReader(out))
+}
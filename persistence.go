@@ -0,0 +1,181 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"time"
+
+	"github.com/FabianWe/gomlmmj/store"
+)
+
+// ChangeType describes the kind of difference Reconcile found between
+// the on-disk spool and the persisted store.
+type ChangeType int
+
+const (
+	ListAdded ChangeType = iota
+	ListRemoved
+	MembersReloaded
+)
+
+// Change is a single difference found by Reconcile.
+type Change struct {
+	Type ChangeType
+	List string
+}
+
+// NewPersistentWrapper is like NewMLMMJWrapper, but also attaches store
+// as the durable index for lists, members and audit events. Every Sub,
+// Unsub and MakeML call that reaches the handler records an AuditEvent
+// with its outcome, successful or not, and Reconcile can be used to
+// catch up with out-of-band mlmmj CLI usage.
+func NewPersistentWrapper(spools []string, handler MLMMJHandler, store *store.Store) (*MLMMJWrapper, error) {
+	wrapper, err := NewMLMMJWrapper(spools, handler)
+	if err != nil {
+		return nil, err
+	}
+	wrapper.store = store
+	return wrapper, nil
+}
+
+func (wrapper *MLMMJWrapper) audit(ctx context.Context, list, actor, mail string, mode UserType, action string, outcome error) {
+	if wrapper.store == nil {
+		return
+	}
+	ev := store.AuditEvent{
+		Timestamp: time.Now(),
+		List:      list,
+		Actor:     actor,
+		Mail:      mail,
+		Mode:      int(mode),
+		Action:    action,
+	}
+	if outcome != nil {
+		ev.Outcome = "error"
+		ev.Err = outcome.Error()
+	} else {
+		ev.Outcome = "ok"
+	}
+	// best effort: a failure to persist the audit trail must not fail
+	// the call that triggered it
+	_ = wrapper.store.Update(func(tx *store.Tx) error {
+		return tx.AppendAuditEvent(ev)
+	})
+}
+
+// Reconcile compares the lists and members found in spool against what
+// is recorded in the store, persists the on-disk state and returns the
+// differences it found. It is meant to be called after Init, so callers
+// can rebuild caches or notify UIs after out-of-band mlmmj CLI usage.
+func (wrapper *MLMMJWrapper) Reconcile(ctx context.Context, spool string) ([]Change, error) {
+	if wrapper.store == nil {
+		return nil, nil
+	}
+	names, err := GetLists(spool)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	err = wrapper.store.Update(func(tx *store.Tx) error {
+		known := make(map[string]bool)
+		existing, err := tx.Lists()
+		if err != nil {
+			return err
+		}
+		for _, l := range existing {
+			if l.Spool == spool {
+				known[l.Name] = true
+			}
+		}
+		seen := make(map[string]bool)
+		for _, name := range names {
+			// the store keys every list by its full spool path, the same
+			// identifier wrapper.audit uses, so that a list is addressed
+			// consistently regardless of which spool it was reached through
+			// and two different spools cannot collide on a shared list name.
+			key := listDir(spool, name)
+			seen[key] = true
+			if !known[key] {
+				changes = append(changes, Change{Type: ListAdded, List: key})
+			}
+			if err := tx.PutList(store.List{Name: key, Spool: spool, CreatedAt: time.Now()}); err != nil {
+				return err
+			}
+			// the list may have been created directly with the mlmmj CLI,
+			// bypassing MakeML, so ListManager might not know about it yet;
+			// register it before reading its members or ListAllMembers would
+			// fail with UnwatchedList.
+			wrapper.lm.AddList(key)
+			subs, digest, nomail, listErr := wrapper.ListAllMembers(ctx, spool, name)
+			if listErr != nil {
+				// a single unreadable list must not roll back the lists
+				// already reconciled in this pass
+				continue
+			}
+			if err := reconcileMembers(tx, key, Subscriber, subs); err != nil {
+				return err
+			}
+			if err := reconcileMembers(tx, key, Digest, digest); err != nil {
+				return err
+			}
+			if err := reconcileMembers(tx, key, Nomail, nomail); err != nil {
+				return err
+			}
+			changes = append(changes, Change{Type: MembersReloaded, List: key})
+			wrapper.Events.Publish(Event{Type: EventMembersReloaded, List: key})
+		}
+		for key := range known {
+			if !seen[key] {
+				changes = append(changes, Change{Type: ListRemoved, List: key})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func reconcileMembers(tx *store.Tx, list string, mode UserType, mails []string) error {
+	current := make(map[string]bool, len(mails))
+	for _, mail := range mails {
+		current[mail] = true
+		if err := tx.PutMember(store.Member{List: list, Mail: mail, Mode: int(mode), Since: time.Now()}); err != nil {
+			return err
+		}
+	}
+	existing, err := tx.ListMembers(list)
+	if err != nil {
+		return err
+	}
+	for _, m := range existing {
+		if m.Mode == int(mode) && !current[m.Mail] {
+			if err := tx.DeleteMember(list, m.Mail, m.Mode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
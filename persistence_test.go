@@ -0,0 +1,137 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FabianWe/gomlmmj/store"
+)
+
+// reconcileFakeHandler returns a fixed membership for every list it is
+// asked about, so Reconcile has something to pick up as if mlmmj had
+// been used directly on the spool.
+type reconcileFakeHandler struct {
+	members map[UserType][]string
+}
+
+func (h *reconcileFakeHandler) MakeML(ctx context.Context, spool, name, domain, owner, lang string) (string, error) {
+	return "", nil
+}
+func (h *reconcileFakeHandler) Sub(ctx context.Context, r SubRequest) (string, error) {
+	return "", nil
+}
+func (h *reconcileFakeHandler) Unsub(ctx context.Context, r UnsubRequest) (string, error) {
+	return "", nil
+}
+func (h *reconcileFakeHandler) List(ctx context.Context, spool, name string, mode UserType) ([]string, error) {
+	return h.members[mode], nil
+}
+func (h *reconcileFakeHandler) Count(ctx context.Context, spool, name string, mode UserType) (int, error) {
+	return len(h.members[mode]), nil
+}
+
+func TestReconcileKeysListsAndMembersByFullSpoolPath(t *testing.T) {
+	spool := t.TempDir()
+	if err := os.Mkdir(filepath.Join(spool, "announce"), 0o755); err != nil {
+		t.Fatalf("Mkdir: %v", err)
+	}
+
+	handler := &reconcileFakeHandler{members: map[UserType][]string{
+		Subscriber: {"a@example.com", "b@example.com"},
+	}}
+	st, err := store.Open(filepath.Join(t.TempDir(), "gomlmmj.db"), false)
+	if err != nil {
+		t.Fatalf("store.Open: %v", err)
+	}
+	wrapper, err := NewPersistentWrapper(nil, handler, st)
+	if err != nil {
+		t.Fatalf("NewPersistentWrapper: %v", err)
+	}
+
+	changes, err := wrapper.Reconcile(context.Background(), spool)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	wantKey := listDir(spool, "announce")
+	var sawAdded, sawReloaded bool
+	for _, c := range changes {
+		if c.List != wantKey {
+			t.Fatalf("Change.List = %q, want the full spool path %q", c.List, wantKey)
+		}
+		switch c.Type {
+		case ListAdded:
+			sawAdded = true
+		case MembersReloaded:
+			sawReloaded = true
+		}
+	}
+	if !sawAdded || !sawReloaded {
+		t.Fatalf("changes = %+v, want a ListAdded and a MembersReloaded for %q", changes, wantKey)
+	}
+
+	var lists []store.List
+	var members []store.Member
+	err = st.View(func(tx *store.Tx) error {
+		var err error
+		lists, err = tx.Lists()
+		if err != nil {
+			return err
+		}
+		members, err = tx.ListMembers(wantKey)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if len(lists) != 1 || lists[0].Name != wantKey {
+		t.Fatalf("Lists() = %+v, want one list keyed by %q", lists, wantKey)
+	}
+	if len(members) != 2 {
+		t.Fatalf("ListMembers(%q) = %+v, want 2 members", wantKey, members)
+	}
+
+	// audit() (used by Sub/Unsub/MakeML) must key AuditEvents under the
+	// same full path Reconcile just used, or the two halves of the store
+	// would silently address two different lists with the same name.
+	subReq := NewSubRequest("c@example.com", "announce")
+	subReq.Spool = spool
+	if _, err := wrapper.Sub(context.Background(), subReq); err != nil {
+		t.Fatalf("Sub: %v", err)
+	}
+	var events []store.AuditEvent
+	if err := st.View(func(tx *store.Tx) error {
+		var err error
+		events, err = tx.AuditEvents(wantKey)
+		return err
+	}); err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if len(events) != 1 || events[0].Mail != "c@example.com" {
+		t.Fatalf("AuditEvents(%q) = %+v, want the Sub call recorded under the same key", wantKey, events)
+	}
+}
@@ -0,0 +1,257 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// RetryMetrics receives counters for RetryHandler's retry and
+// circuit-breaker behavior, so operators can export them as
+// Prometheus-style metrics (mlmmj_handler_retries_total,
+// mlmmj_handler_circuit_open).
+type RetryMetrics interface {
+	IncRetry(list string)
+	IncCircuitOpen(list string)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncRetry(string)       {}
+func (noopMetrics) IncCircuitOpen(string) {}
+
+type breakerState struct {
+	mutex               sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+}
+
+// RetryHandler wraps any MLMMJHandler with exponential backoff and a
+// per-list circuit breaker. Only retryable errors (network failures and
+// a JSON-RPC server error) are retried; user errors such as
+// UnwatchedList or an invalid UserType fail fast. See isRetryable for
+// the exact classification.
+type RetryHandler struct {
+	Handler MLMMJHandler
+	// RetryLimit is the maximum number of attempts per call, defaulting
+	// to math.MaxInt32 so callers effectively retry until the context is
+	// cancelled.
+	RetryLimit int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	// FailureThreshold is the number of consecutive failures against the
+	// same list that trips the circuit breaker.
+	FailureThreshold int
+	// OpenDuration is how long the breaker stays open once tripped.
+	OpenDuration time.Duration
+	Metrics      RetryMetrics
+
+	breakers sync.Map // string -> *breakerState
+}
+
+// NewRetryHandler wraps handler with the defaults: unlimited retries
+// (math.MaxInt32), 200ms base / 10s max backoff, a breaker that trips
+// after 5 consecutive failures and stays open for 30s.
+func NewRetryHandler(handler MLMMJHandler) *RetryHandler {
+	return &RetryHandler{
+		Handler:          handler,
+		RetryLimit:       math.MaxInt32,
+		BaseDelay:        200 * time.Millisecond,
+		MaxDelay:         10 * time.Second,
+		FailureThreshold: 5,
+		OpenDuration:     30 * time.Second,
+		Metrics:          noopMetrics{},
+	}
+}
+
+var errCircuitOpen = errors.New("mlmmj handler: circuit open for this list")
+
+// isRetryable classifies errors returned by MLMMJHandler methods.
+// Network failures (timeouts, connection resets, ...) and the
+// JSONRPCHandler's own server-error codes are retried; UnwatchedList and
+// an invalid UserType are user errors and fail fast instead. Note that
+// DockerHandler.post currently discards the HTTP status code of a
+// non-2xx response (it only looks at the ReturnCode in the JSON body),
+// so a real 5xx from the docker-fronted worker is not distinguishable
+// here and is not retried either; only JSONRPCHandler's errors carry
+// enough information for that today.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, UnwatchedList) {
+		return false
+	}
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case codeUnwatchedList, codeInvalidUserType:
+			return false
+		default:
+			return true
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return false
+}
+
+func (handler *RetryHandler) breaker(list string) *breakerState {
+	v, _ := handler.breakers.LoadOrStore(list, &breakerState{})
+	return v.(*breakerState)
+}
+
+func (handler *RetryHandler) checkCircuit(list string) error {
+	b := handler.breaker(list)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.openUntil.IsZero() && time.Now().Before(b.openUntil) {
+		return errCircuitOpen
+	}
+	return nil
+}
+
+func (handler *RetryHandler) recordResult(list string, err error) {
+	b := handler.breaker(list)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil {
+		b.consecutiveFailures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	b.consecutiveFailures++
+	if b.consecutiveFailures >= handler.FailureThreshold {
+		b.openUntil = time.Now().Add(handler.OpenDuration)
+		handler.Metrics.IncCircuitOpen(list)
+	}
+}
+
+func (handler *RetryHandler) backoff(attempt int) time.Duration {
+	delay := handler.BaseDelay * time.Duration(1<<uint(attempt))
+	if delay > handler.MaxDelay || delay <= 0 {
+		delay = handler.MaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2+1)))
+}
+
+// retry runs fn, retrying while isRetryable(err) holds, up to
+// RetryLimit attempts, honoring the circuit breaker for list and ctx
+// cancellation. fn is expected to store its result in a variable
+// captured by the caller before returning its error.
+//
+// The circuit breaker hears about every outcome of a real call to fn: a
+// success resets it, and a retryable failure counts toward
+// consecutiveFailures regardless of whether this invocation of retry
+// eventually gives up because RetryLimit was reached or because ctx was
+// cancelled while waiting out the backoff — with RetryLimit defaulting
+// to math.MaxInt32, ctx cancellation is how most callers actually give
+// up, so the breaker would never see a failure otherwise. A fail-fast
+// classification error (UnwatchedList, an invalid UserType, ...) says
+// nothing about the health of the underlying mlmmj worker, so it never
+// reaches fn a second time and never counts toward consecutiveFailures.
+func (handler *RetryHandler) retry(ctx context.Context, list string, fn func() error) error {
+	if err := handler.checkCircuit(list); err != nil {
+		return err
+	}
+	limit := handler.RetryLimit
+	if limit < 1 {
+		limit = 1
+	}
+	var err error
+	for attempt := 0; attempt < limit; attempt++ {
+		err = fn()
+		if err == nil {
+			handler.recordResult(list, nil)
+			return nil
+		}
+		if !isRetryable(err) {
+			return err
+		}
+		if attempt == limit-1 {
+			break
+		}
+		handler.Metrics.IncRetry(list)
+		select {
+		case <-ctx.Done():
+			handler.recordResult(list, err)
+			return ctx.Err()
+		case <-time.After(handler.backoff(attempt)):
+		}
+	}
+	handler.recordResult(list, err)
+	return err
+}
+
+func (handler *RetryHandler) MakeML(ctx context.Context, spool, name, domain, owner, lang string) (string, error) {
+	var result string
+	err := handler.retry(ctx, listDir(spool, name), func() (callErr error) {
+		result, callErr = handler.Handler.MakeML(ctx, spool, name, domain, owner, lang)
+		return
+	})
+	return result, err
+}
+
+func (handler *RetryHandler) Sub(ctx context.Context, r SubRequest) (string, error) {
+	var result string
+	err := handler.retry(ctx, listDir(r.Spool, r.Name), func() (callErr error) {
+		result, callErr = handler.Handler.Sub(ctx, r)
+		return
+	})
+	return result, err
+}
+
+func (handler *RetryHandler) Unsub(ctx context.Context, r UnsubRequest) (string, error) {
+	var result string
+	err := handler.retry(ctx, listDir(r.Spool, r.Name), func() (callErr error) {
+		result, callErr = handler.Handler.Unsub(ctx, r)
+		return
+	})
+	return result, err
+}
+
+func (handler *RetryHandler) List(ctx context.Context, spool, name string, mode UserType) ([]string, error) {
+	var result []string
+	err := handler.retry(ctx, listDir(spool, name), func() (callErr error) {
+		result, callErr = handler.Handler.List(ctx, spool, name, mode)
+		return
+	})
+	return result, err
+}
+
+func (handler *RetryHandler) Count(ctx context.Context, spool, name string, mode UserType) (int, error) {
+	result := -1
+	err := handler.retry(ctx, listDir(spool, name), func() (callErr error) {
+		result, callErr = handler.Handler.Count(ctx, spool, name, mode)
+		return
+	})
+	return result, err
+}
@@ -0,0 +1,184 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package gomlmmj
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeNetError struct{}
+
+func (fakeNetError) Error() string   { return "fake network error" }
+func (fakeNetError) Timeout() bool   { return true }
+func (fakeNetError) Temporary() bool { return true }
+
+var _ net.Error = fakeNetError{}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unwatched list", UnwatchedList, false},
+		{"wrapped unwatched list", fmtErrorf(UnwatchedList), false},
+		{"invalid subscription type", errors.New("Invalid subscription type 3 for subscription"), false},
+		{"network error", fakeNetError{}, true},
+		{"rpc unwatched list", &rpcError{Code: codeUnwatchedList, Message: "x"}, false},
+		{"rpc invalid user type", &rpcError{Code: codeInvalidUserType, Message: "x"}, false},
+		{"rpc cli error", &rpcError{Code: codeCLIError, Message: "x"}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isRetryable(tc.err); got != tc.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func fmtErrorf(err error) error {
+	return errFmtWrap{err}
+}
+
+type errFmtWrap struct{ err error }
+
+func (e errFmtWrap) Error() string { return "wrapped: " + e.err.Error() }
+func (e errFmtWrap) Unwrap() error { return e.err }
+
+// countingHandler always fails every call with err, counting attempts.
+type countingHandler struct {
+	err      error
+	attempts int
+}
+
+func (h *countingHandler) MakeML(ctx context.Context, spool, name, domain, owner, lang string) (string, error) {
+	h.attempts++
+	return "", h.err
+}
+func (h *countingHandler) Sub(ctx context.Context, r SubRequest) (string, error) {
+	h.attempts++
+	return "", h.err
+}
+func (h *countingHandler) Unsub(ctx context.Context, r UnsubRequest) (string, error) {
+	h.attempts++
+	return "", h.err
+}
+func (h *countingHandler) List(ctx context.Context, spool, name string, mode UserType) ([]string, error) {
+	h.attempts++
+	return nil, h.err
+}
+func (h *countingHandler) Count(ctx context.Context, spool, name string, mode UserType) (int, error) {
+	h.attempts++
+	return -1, h.err
+}
+
+func TestRetryHandlerTripsCircuitOnlyOnBackendFailures(t *testing.T) {
+	inner := &countingHandler{err: fakeNetError{}}
+	h := NewRetryHandler(inner)
+	h.RetryLimit = 1
+	h.BaseDelay = time.Millisecond
+	h.MaxDelay = time.Millisecond
+	h.FailureThreshold = 3
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.Count(context.Background(), "/spool", "list", Subscriber); err == nil {
+			t.Fatal("expected error from countingHandler")
+		}
+	}
+	if err := h.checkCircuit(listDir("/spool", "list")); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected circuit to be open after %d backend failures, got %v", h.FailureThreshold, err)
+	}
+}
+
+func TestRetryHandlerDoesNotTripCircuitOnFailFastErrors(t *testing.T) {
+	inner := &countingHandler{err: UnwatchedList}
+	h := NewRetryHandler(inner)
+	h.FailureThreshold = 3
+
+	for i := 0; i < 10; i++ {
+		if _, err := h.Count(context.Background(), "/spool", "list", Subscriber); !errors.Is(err, UnwatchedList) {
+			t.Fatalf("expected UnwatchedList, got %v", err)
+		}
+	}
+	if inner.attempts != 10 {
+		t.Fatalf("fail-fast error should not be retried, got %d attempts for 10 calls", inner.attempts)
+	}
+	if err := h.checkCircuit(listDir("/spool", "list")); err != nil {
+		t.Fatalf("circuit should stay closed on fail-fast errors, got %v", err)
+	}
+}
+
+// TestRetryHandlerTripsCircuitOnCancelledContextAfterBackendFailure
+// verifies that a retry() invocation which gives up because ctx was
+// cancelled still counts toward the breaker: fn already failed with a
+// retryable backend error before ctx.Done() was observed, so the call
+// really did fail, regardless of why retry stopped trying again. This
+// is what lets the breaker trip in practice, since the shipped
+// RetryLimit default is effectively unbounded and most callers rely on
+// their own ctx deadline rather than on RetryLimit exhausting.
+func TestRetryHandlerTripsCircuitOnCancelledContextAfterBackendFailure(t *testing.T) {
+	inner := &countingHandler{err: fakeNetError{}}
+	h := NewRetryHandler(inner)
+	h.RetryLimit = 5
+	h.BaseDelay = time.Hour
+	h.MaxDelay = time.Hour
+	h.FailureThreshold = 3
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := h.Count(ctx, "/spool", "list", Subscriber); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	}
+	if err := h.checkCircuit(listDir("/spool", "list")); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("expected circuit to be open after %d cancelled calls that each failed once against the backend, got %v", h.FailureThreshold, err)
+	}
+}
+
+// TestRetryHandlerDoesNotTripCircuitOnImmediatelyCancelledFailFastContext
+// checks the one case that must still never count: a fail-fast
+// classification error returns before retry ever reaches the ctx.Done()
+// select, so it behaves exactly as without cancellation.
+func TestRetryHandlerDoesNotTripCircuitOnImmediatelyCancelledFailFastContext(t *testing.T) {
+	inner := &countingHandler{err: UnwatchedList}
+	h := NewRetryHandler(inner)
+	h.FailureThreshold = 3
+
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := h.Count(ctx, "/spool", "list", Subscriber); !errors.Is(err, UnwatchedList) {
+			t.Fatalf("expected UnwatchedList, got %v", err)
+		}
+	}
+	if err := h.checkCircuit(listDir("/spool", "list")); err != nil {
+		t.Fatalf("circuit should stay closed on fail-fast errors even with a cancelled ctx, got %v", err)
+	}
+}
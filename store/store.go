@@ -0,0 +1,286 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package store persists the durable state gomlmmj keeps about the lists
+// it manages: which lists are known, who is subscribed to them and the
+// history of sub/unsub operations performed through the wrapper.
+//
+// The database is a single gob-encoded snapshot written atomically on
+// every Update, guarded by an in-process mutex. That is enough for a
+// single gomlmmj process to survive a restart without pulling in a
+// third-party embedded database.
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// currentSchemaVersion is bumped whenever the persisted layout changes.
+// migrate brings an older database up to date on Open.
+const currentSchemaVersion = 1
+
+// List is the persisted record of a mailing list known to the store.
+type List struct {
+	Name      string
+	Spool     string
+	Domain    string
+	Owner     string
+	Lang      string
+	CreatedAt time.Time
+}
+
+// Member is the persisted record of a single subscriber, moderator or
+// owner of a list. Mode mirrors gomlmmj.UserType, duplicated here so
+// store has no dependency on the parent package.
+type Member struct {
+	List  string
+	Mail  string
+	Mode  int
+	Since time.Time
+}
+
+// AuditEvent records the outcome of a single Sub/Unsub/MakeML call.
+type AuditEvent struct {
+	Timestamp time.Time
+	List      string
+	Actor     string
+	Mail      string
+	Mode      int
+	Action    string
+	Outcome   string
+	Err       string
+}
+
+func memberKey(list, mail string, mode int) string {
+	return fmt.Sprintf("%s\x00%d\x00%s", list, mode, mail)
+}
+
+// state is the full persisted snapshot, gob-encoded as a whole.
+type state struct {
+	SchemaVersion int
+	Lists         map[string]List
+	Members       map[string]Member
+	Audit         map[string][]AuditEvent
+}
+
+func newState() *state {
+	return &state{
+		SchemaVersion: currentSchemaVersion,
+		Lists:         make(map[string]List),
+		Members:       make(map[string]Member),
+		Audit:         make(map[string][]AuditEvent),
+	}
+}
+
+func (s *state) clone() *state {
+	c := newState()
+	c.SchemaVersion = s.SchemaVersion
+	for k, v := range s.Lists {
+		c.Lists[k] = v
+	}
+	for k, v := range s.Members {
+		c.Members[k] = v
+	}
+	for k, v := range s.Audit {
+		c.Audit[k] = append([]AuditEvent(nil), v...)
+	}
+	return c
+}
+
+// migrate brings st up to currentSchemaVersion in place.
+func migrate(st *state) {
+	for st.SchemaVersion < currentSchemaVersion {
+		switch st.SchemaVersion {
+		case 0:
+			// initial schema, nothing to migrate from
+		}
+		st.SchemaVersion++
+	}
+}
+
+// Store is a durable, transactional index of lists, members and audit
+// events, persisted to a single file on disk.
+type Store struct {
+	mutex    sync.Mutex
+	path     string
+	readOnly bool
+	state    *state
+}
+
+// Open opens (and if necessary creates and migrates) the database at
+// path. A read-only store can be opened with readOnly set to true, in
+// which case Update fails and no file is written.
+func Open(path string, readOnly bool) (*Store, error) {
+	st := newState()
+	raw, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		dec := gob.NewDecoder(bytes.NewReader(raw))
+		if decErr := dec.Decode(st); decErr != nil {
+			return nil, fmt.Errorf("store: decoding %s: %w", path, decErr)
+		}
+		migrate(st)
+	case os.IsNotExist(err):
+		// start from an empty, freshly migrated database
+	default:
+		return nil, fmt.Errorf("store: reading %s: %w", path, err)
+	}
+	s := &Store{path: path, readOnly: readOnly, state: st}
+	if !readOnly {
+		if err := s.persist(st); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) persist(st *state) error {
+	dir := filepath.Dir(s.path)
+	tmp, err := os.CreateTemp(dir, ".store-*.tmp")
+	if err != nil {
+		return fmt.Errorf("store: creating temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if err := gob.NewEncoder(tmp).Encode(st); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("store: encoding: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("store: closing temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("store: renaming temp file: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op: every Update already persists to disk.
+func (s *Store) Close() error {
+	return nil
+}
+
+// Tx is a transactional view of the store, valid only for the duration
+// of the Update or View call that produced it.
+type Tx struct {
+	state *state
+}
+
+// Update runs fn against a private copy of the store. If fn returns an
+// error the copy is discarded and the store is left untouched;
+// otherwise the copy is persisted to disk and becomes the new state.
+func (s *Store) Update(fn func(*Tx) error) error {
+	if s.readOnly {
+		return fmt.Errorf("store: update on a read-only store")
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	clone := s.state.clone()
+	if err := fn(&Tx{state: clone}); err != nil {
+		return err
+	}
+	if err := s.persist(clone); err != nil {
+		return err
+	}
+	s.state = clone
+	return nil
+}
+
+// View runs fn against the current state. Mutating methods called on
+// the Tx inside View are not persisted.
+func (s *Store) View(fn func(*Tx) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return fn(&Tx{state: s.state.clone()})
+}
+
+// Snapshot writes a consistent copy of the whole database to w, suitable
+// for backups.
+func (s *Store) Snapshot(w io.Writer) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return gob.NewEncoder(w).Encode(s.state)
+}
+
+// PutList creates or updates the persisted record for a list.
+func (t *Tx) PutList(l List) error {
+	t.state.Lists[l.Name] = l
+	return nil
+}
+
+// GetList returns the persisted record for name, or ok=false if unknown.
+func (t *Tx) GetList(name string) (l List, ok bool, err error) {
+	l, ok = t.state.Lists[name]
+	return l, ok, nil
+}
+
+// Lists returns every persisted list record.
+func (t *Tx) Lists() ([]List, error) {
+	res := make([]List, 0, len(t.state.Lists))
+	for _, l := range t.state.Lists {
+		res = append(res, l)
+	}
+	return res, nil
+}
+
+// PutMember creates or updates the persisted record for a member.
+func (t *Tx) PutMember(m Member) error {
+	t.state.Members[memberKey(m.List, m.Mail, m.Mode)] = m
+	return nil
+}
+
+// DeleteMember removes the persisted record for mail in list under mode.
+func (t *Tx) DeleteMember(list, mail string, mode int) error {
+	delete(t.state.Members, memberKey(list, mail, mode))
+	return nil
+}
+
+// ListMembers returns every member persisted for list.
+func (t *Tx) ListMembers(list string) ([]Member, error) {
+	var res []Member
+	for _, m := range t.state.Members {
+		if m.List == list {
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+// AppendAuditEvent appends ev to the audit log of ev.List.
+func (t *Tx) AppendAuditEvent(ev AuditEvent) error {
+	t.state.Audit[ev.List] = append(t.state.Audit[ev.List], ev)
+	return nil
+}
+
+// AuditEvents returns every audit event recorded for list, oldest first.
+func (t *Tx) AuditEvents(list string) ([]AuditEvent, error) {
+	return append([]AuditEvent(nil), t.state.Audit[list]...), nil
+}
@@ -0,0 +1,118 @@
+// The MIT License (MIT)
+
+// Copyright (c) 2017 Fabian Wenzelmann
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package store
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+var errFailedUpdate = errors.New("store_test: simulated failure")
+
+func TestStoreUpdateSurvivesReopenAndSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gomlmmj.db")
+
+	s, err := Open(path, false)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	err = s.Update(func(tx *Tx) error {
+		if err := tx.PutList(List{Name: "/spool/announce", Spool: "/spool"}); err != nil {
+			return err
+		}
+		return tx.PutMember(Member{List: "/spool/announce", Mail: "a@example.com", Mode: 0})
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	reopened, err := Open(path, true)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	var lists []List
+	var members []Member
+	err = reopened.View(func(tx *Tx) error {
+		var err error
+		lists, err = tx.Lists()
+		if err != nil {
+			return err
+		}
+		members, err = tx.ListMembers("/spool/announce")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if len(lists) != 1 || lists[0].Name != "/spool/announce" {
+		t.Fatalf("Lists() after reopen = %+v, want one list /spool/announce", lists)
+	}
+	if len(members) != 1 || members[0].Mail != "a@example.com" {
+		t.Fatalf("ListMembers() after reopen = %+v, want one member a@example.com", members)
+	}
+
+	var buf bytes.Buffer
+	if err := reopened.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if buf.Len() == 0 {
+		t.Fatal("Snapshot() wrote no bytes")
+	}
+
+	if err := reopened.Update(func(tx *Tx) error { return nil }); err == nil {
+		t.Fatal("Update on a read-only store should fail")
+	}
+}
+
+func TestUpdateDiscardsStateOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gomlmmj.db")
+	s, err := Open(path, false)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	sentinel := errFailedUpdate
+	err = s.Update(func(tx *Tx) error {
+		if err := tx.PutList(List{Name: "/spool/doomed"}); err != nil {
+			return err
+		}
+		return sentinel
+	})
+	if err != sentinel {
+		t.Fatalf("Update() error = %v, want %v", err, sentinel)
+	}
+
+	var lists []List
+	if err := s.View(func(tx *Tx) error {
+		var err error
+		lists, err = tx.Lists()
+		return err
+	}); err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if len(lists) != 0 {
+		t.Fatalf("Lists() after a failed Update = %+v, want none", lists)
+	}
+}
@@ -35,6 +35,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/FabianWe/gomlmmj/store"
 )
 
 func GetLists(spool string) ([]string, error) {
@@ -277,6 +279,14 @@ var (
 type MLMMJWrapper struct {
 	lm      *ListManager
 	handler MLMMJHandler
+	// store is nil unless the wrapper was created with
+	// NewPersistentWrapper, in which case every Sub/Unsub/MakeML call
+	// that reaches the handler also records an audit event.
+	store *store.Store
+	// Events publishes an Event whenever MakeML, Sub or Unsub complete
+	// successfully. Register on it to receive live updates instead of
+	// polling List/Count.
+	Events *Broadcaster
 }
 
 func NewMLMMJWrapper(spools []string, handler MLMMJHandler) (*MLMMJWrapper, error) {
@@ -284,18 +294,20 @@ func NewMLMMJWrapper(spools []string, handler MLMMJHandler) (*MLMMJWrapper, erro
 	if err := lm.Init(spools); err != nil {
 		return nil, err
 	}
-	return &MLMMJWrapper{lm: lm, handler: handler}, nil
+	return &MLMMJWrapper{lm: lm, handler: handler, Events: NewBroadcaster()}, nil
 }
 
 // TODO chown?
 func (wrapper *MLMMJWrapper) MakeML(ctx context.Context, spool, name, domain, owner, lang string) (string, error) {
 	// first try to create the list
 	output, err := wrapper.handler.MakeML(ctx, spool, name, domain, owner, lang)
+	wrapper.audit(ctx, listDir(spool, name), owner, "", Owner, "make-ml", err)
 	if err != nil {
 		return output, err
 	}
 	// creation successful, add to the manager
 	wrapper.lm.AddList(listDir(spool, name))
+	wrapper.Events.Publish(Event{Type: EventListCreated, List: listDir(spool, name)})
 	return output, err
 }
 
@@ -307,7 +319,12 @@ func (wrapper *MLMMJWrapper) Sub(ctx context.Context, r SubRequest) (string, err
 		return "", UnwatchedList
 	}
 	// subscribe
-	return wrapper.handler.Sub(ctx, r)
+	output, err := wrapper.handler.Sub(ctx, r)
+	wrapper.audit(ctx, listDir(r.Spool, r.Name), "", r.Mail, r.Mode, "sub", err)
+	if err == nil {
+		wrapper.Events.Publish(Event{Type: EventMemberSubscribed, List: listDir(r.Spool, r.Name), Mail: r.Mail, Mode: r.Mode})
+	}
+	return output, err
 }
 
 func (wrapper *MLMMJWrapper) Unsub(ctx context.Context, r UnsubRequest) (string, error) {
@@ -318,7 +335,12 @@ func (wrapper *MLMMJWrapper) Unsub(ctx context.Context, r UnsubRequest) (string,
 		return "", UnwatchedList
 	}
 	// unsub
-	return wrapper.handler.Unsub(ctx, r)
+	output, err := wrapper.handler.Unsub(ctx, r)
+	wrapper.audit(ctx, listDir(r.Spool, r.Name), "", r.Mail, r.Mode, "unsub", err)
+	if err == nil {
+		wrapper.Events.Publish(Event{Type: EventMemberUnsubscribed, List: listDir(r.Spool, r.Name), Mail: r.Mail, Mode: r.Mode})
+	}
+	return output, err
 }
 
 func (wrapper *MLMMJWrapper) List(ctx context.Context, spool, name string, mode UserType) ([]string, error) {